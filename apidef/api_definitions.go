@@ -0,0 +1,166 @@
+package apidef
+
+// OpenIDOptions configures the OpenID Connect / OIDC authentication mode for
+// an API. Providers are looked up by issuer, and each provider maps its
+// registered client IDs to the Tyk policy that should be applied to tokens
+// issued for that client.
+type OpenIDOptions struct {
+	Enabled           bool                `bson:"enabled" json:"enabled"`
+	SegregateByClient bool                `bson:"segregate_by_client" json:"segregate_by_client"`
+	Providers         []OIDProviderConfig `bson:"providers" json:"providers"`
+}
+
+// OIDProviderConfig describes a single OpenID Connect provider (issuer) that
+// an API will accept tokens from.
+type OIDProviderConfig struct {
+	Issuer    string            `bson:"issuer" json:"issuer"`
+	ClientIDs map[string]string `bson:"client_ids" json:"client_ids"`
+
+	// JWKSURL overrides the JWKS endpoint for this provider. When empty,
+	// the JWKS location is discovered from
+	// "<Issuer>/.well-known/openid-configuration".
+	JWKSURL string `bson:"jwks_url" json:"jwks_url"`
+
+	// JWKSCacheTTL is how long, in seconds, a fetched key set is
+	// considered fresh before it is eligible for background rotation.
+	// Defaults to 1 hour when unset.
+	JWKSCacheTTL int64 `bson:"jwks_cache_ttl" json:"jwks_cache_ttl"`
+
+	// AllowedAlgorithms restricts which JWT "alg" values will be
+	// accepted. Defaults to the RS*/ES* family; "none" and HS* are
+	// rejected unless listed. Listing them only passes the algorithm
+	// check: JWKS keys are decoded as RSA or EC keys only, so such tokens
+	// still fail signature validation.
+	AllowedAlgorithms []string `bson:"allowed_algorithms" json:"allowed_algorithms"`
+
+	// HTTPTimeout is the timeout, in seconds, applied to discovery and
+	// JWKS HTTP requests for this provider. Defaults to 10 seconds.
+	HTTPTimeout int64 `bson:"http_timeout" json:"http_timeout"`
+
+	// EnableUserInfo causes the middleware to call the provider's
+	// userinfo_endpoint with the incoming bearer token and merge the
+	// result into the request context and session metadata.
+	EnableUserInfo bool `bson:"enable_userinfo" json:"enable_userinfo"`
+
+	// UserInfoCacheTTL is how long, in seconds, a userinfo response is
+	// cached per-token. Defaults to 5 minutes when unset.
+	UserInfoCacheTTL int64 `bson:"userinfo_cache_ttl" json:"userinfo_cache_ttl"`
+
+	// ClaimPolicyMap is an ordered list of claim-based policy selection
+	// rules, evaluated against the merged id_token and userinfo claims
+	// when no direct aud->policy match is found via ClientIDs. The first
+	// matching rule wins.
+	ClaimPolicyMap []ClaimPolicyRule `bson:"claim_policy_map" json:"claim_policy_map"`
+
+	// Introspection configures RFC 7662 token introspection, used to
+	// catch tokens that were revoked at the IdP before their exp.
+	Introspection IntrospectionConfig `bson:"introspection" json:"introspection"`
+
+	// RequiredClaims is a declarative list of extra claim assertions,
+	// evaluated in order, beyond the standard iss/aud checks. All rules
+	// must pass. See ClaimRule for the supported operators.
+	RequiredClaims []ClaimRule `bson:"required_claims" json:"required_claims"`
+
+	// ClientAuth configures how Tyk itself authenticates to this
+	// provider as a confidential client, e.g. to fetch a JWKS that sits
+	// behind auth, or to call the introspection endpoint. Userinfo calls
+	// use the incoming bearer token, not this client's token.
+	ClientAuth ClientAuthConfig `bson:"client_auth" json:"client_auth"`
+
+	// RequireExactAudience rejects tokens whose aud array contains any
+	// client_id not registered for this API, closing the multi-tenant
+	// leakage window where a token minted for a sibling API is also
+	// accepted here because one of several auds happens to match.
+	RequireExactAudience bool `bson:"require_exact_audience" json:"require_exact_audience"`
+
+	// RequireAzp requires and validates the azp claim whenever aud is
+	// multi-valued.
+	RequireAzp bool `bson:"require_azp" json:"require_azp"`
+
+	// AllowedIssuers is an additional regex allowlist for the iss claim,
+	// layered on top of the exact issuer match already required to
+	// locate this provider's client map.
+	AllowedIssuers []string `bson:"allowed_issuers" json:"allowed_issuers"`
+
+	// MaxTokenLifetime rejects tokens whose exp-iat exceeds this many
+	// seconds.
+	MaxTokenLifetime int64 `bson:"max_token_lifetime" json:"max_token_lifetime"`
+
+	// RequireNonce requires a non-empty nonce claim and rejects a jti
+	// that has already been seen within the token's remaining lifetime.
+	// The replay store is currently process-local, so this only catches
+	// a replay that lands back on the same gateway node.
+	RequireNonce bool `bson:"require_nonce" json:"require_nonce"`
+}
+
+// ClientAuthConfig configures Tyk's own client credentials against an OIDC
+// provider.
+type ClientAuthConfig struct {
+	// Mode is "client_secret_basic" or "private_key_jwt". Empty disables
+	// client authentication (the previous, unauthenticated behaviour).
+	Mode string `bson:"mode" json:"mode"`
+
+	ClientID     string `bson:"client_id" json:"client_id"`
+	ClientSecret string `bson:"client_secret" json:"client_secret"`
+
+	// TokenEndpoint overrides the token endpoint otherwise discovered
+	// from "<Issuer>/.well-known/openid-configuration".
+	TokenEndpoint string `bson:"token_endpoint" json:"token_endpoint"`
+
+	// PrivateKeyFile is a PEM file (PKCS#1 or PKCS#8) containing the RSA
+	// private key used to sign private_key_jwt client assertions with
+	// RS256. EC keys are not supported.
+	PrivateKeyFile string `bson:"private_key_file" json:"private_key_file"`
+
+	// JWKSFile, combined with KeyID, is an alternative to PrivateKeyFile:
+	// a JWK set on disk containing the private key to sign with.
+	JWKSFile string `bson:"jwks_file" json:"jwks_file"`
+	KeyID    string `bson:"key_id" json:"key_id"`
+
+	Scopes []string `bson:"scopes" json:"scopes"`
+}
+
+// ClaimRule asserts something about a dotted claim path (e.g.
+// "realm_access.roles") in the token's claims. Userinfo claims are not
+// included.
+//
+// Operator is one of: "equals", "contains", "regex", "oneOf", "exists".
+// Value is used by equals/contains/regex; Values is used by oneOf.
+type ClaimRule struct {
+	Path     string   `bson:"path" json:"path"`
+	Operator string   `bson:"operator" json:"operator"`
+	Value    string   `bson:"value" json:"value"`
+	Values   []string `bson:"values" json:"values"`
+}
+
+// IntrospectionConfig configures RFC 7662 introspection-based revocation
+// checking for a single OIDC provider.
+//
+// The result cache is currently process-local: on a multi-node gateway, a
+// revocation is only enforced on the node whose introspection call
+// observed it until each node's own cache entry expires.
+type IntrospectionConfig struct {
+	Enabled      bool   `bson:"enabled" json:"enabled"`
+	Endpoint     string `bson:"endpoint" json:"endpoint"`
+	ClientID     string `bson:"client_id" json:"client_id"`
+	ClientSecret string `bson:"client_secret" json:"client_secret"`
+
+	// CacheTTL is the maximum time, in seconds, an introspection result
+	// is cached for. The effective TTL is min(CacheTTL, exp-now).
+	CacheTTL int64 `bson:"cache_ttl" json:"cache_ttl"`
+
+	// Required, when true, fails the request closed if the introspection
+	// call itself cannot be completed (e.g. the IdP is unreachable).
+	// When false, introspection is best-effort and a failed call allows
+	// the request through.
+	Required bool `bson:"required" json:"required"`
+}
+
+// ClaimPolicyRule maps a claim/value match to a Tyk policy ID, e.g.
+// {Claim: "groups", Value: "admins", PolicyID: "<id>"} applies <id> to any
+// token whose "groups" claim contains "admins".
+type ClaimPolicyRule struct {
+	Claim    string `bson:"claim" json:"claim"`
+	Value    string `bson:"value" json:"value"`
+	PolicyID string `bson:"policy_id" json:"policy_id"`
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/context"
@@ -22,7 +24,36 @@ type OpenIDMW struct {
 	*TykMiddleware
 	providerConfiguration     *openid.Configuration
 	provider_client_policymap map[string]map[string]string
+	providerConfigByIssuer    map[string]apidef.OIDProviderConfig
 	lock                      sync.RWMutex
+	jwksManager               *JWKSManager
+	userInfoCache             *UserInfoCache
+	introspectionCache        *IntrospectionCache
+	clientAuthManager         *ClientAuthManager
+	nonceStore                replayStore
+}
+
+// providerKeyConfig is the subset of apidef.OIDProviderConfig that the
+// JWKSManager needs in order to fetch and validate signing keys for an
+// issuer.
+type providerKeyConfig struct {
+	Issuer            string
+	JWKSURL           string
+	CacheTTL          time.Duration
+	AllowedAlgorithms []string
+	ClientAuth        apidef.ClientAuthConfig
+	HTTPTimeout       time.Duration
+}
+
+func newProviderKeyConfig(cfg apidef.OIDProviderConfig) providerKeyConfig {
+	return providerKeyConfig{
+		Issuer:            cfg.Issuer,
+		JWKSURL:           cfg.JWKSURL,
+		CacheTTL:          time.Duration(cfg.JWKSCacheTTL) * time.Second,
+		AllowedAlgorithms: cfg.AllowedAlgorithms,
+		ClientAuth:        cfg.ClientAuth,
+		HTTPTimeout:       httpTimeout(cfg.HTTPTimeout),
+	}
 }
 
 func (k *OpenIDMW) GetName() string {
@@ -31,6 +62,28 @@ func (k *OpenIDMW) GetName() string {
 
 func (k *OpenIDMW) New() {
 	k.provider_client_policymap = make(map[string]map[string]string)
+	k.providerConfigByIssuer = make(map[string]apidef.OIDProviderConfig)
+	if k.jwksManager != nil {
+		// An API reload calls New() again on the same OpenIDMW; stop the
+		// manager being replaced so its background rotation goroutines
+		// don't leak.
+		k.jwksManager.Stop()
+	}
+	k.jwksManager = newJWKSManager()
+	if k.userInfoCache != nil {
+		// Same reload-leak concern as jwksManager above: stop the sweep
+		// goroutine on the cache being replaced.
+		k.userInfoCache.Stop()
+	}
+	k.userInfoCache = newUserInfoCache()
+	k.clientAuthManager = newClientAuthManager(k.jwksManager)
+	k.jwksManager.SetClientAuthManager(k.clientAuthManager)
+	// sharedInMemoryStore() is process-wide, not per-instance, so an API
+	// reload (which calls New() again) doesn't wipe introspection-cache
+	// and nonce-replay state. It is still single-node only -- see
+	// inMemoryIntrospectionStore's doc comment for the multi-node caveat.
+	k.introspectionCache = newIntrospectionCache(sharedInMemoryStore(), k.clientAuthManager)
+	k.nonceStore = sharedInMemoryStore()
 	// Create an OpenID Configuration and store
 	var err error
 	k.providerConfiguration, err = openid.NewConfiguration(openid.ProvidersGetter(k.getProviders),
@@ -53,6 +106,11 @@ func (k *OpenIDMW) getProviders() ([]openid.Provider, error) {
 	for _, provider := range k.TykMiddleware.Spec.OpenIDOptions.Providers {
 		iss := provider.Issuer
 		log.Debug("Setting up Issuer: ", iss)
+
+		k.lock.Lock()
+		k.providerConfigByIssuer[iss] = provider
+		k.lock.Unlock()
+
 		providerClientArray := make([]string, len(provider.ClientIDs))
 
 		i := 0
@@ -102,7 +160,18 @@ func (k *OpenIDMW) GetConfig() (interface{}, error) {
 }
 
 func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
-	// 1. Validate the JWT
+	// 1a. Verify the signature ourselves against the provider's JWKS
+	// before handing off to openid2go, rather than trusting whatever
+	// key-fetching behaviour the library defaults to.
+	if err := k.verifyJWKSSignature(r); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": OIDPREFIX,
+		}).Warning("JWKS signature validation failed: ", err)
+		k.reportLoginFailure("[JWT]", r)
+		return errors.New("Key not authorised"), 403
+	}
+
+	// 1b. Validate the JWT
 	user, token, halt := openid.AuthenticateOIDWithUser(k.providerConfiguration, w, r)
 
 	// 2. Generate the internal representation for the key
@@ -135,6 +204,77 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 		return errors.New("Key not authorised"), 403
 	}
 
+	k.lock.RLock()
+	providerCfg, hasProviderCfg := k.providerConfigByIssuer[iss.(string)]
+	k.lock.RUnlock()
+
+	// 3a0. Tenant-isolation and replay checks. These are independent of
+	// which client_id the token is for, so they run before the aud match.
+	if hasProviderCfg {
+		if err := k.enforceTenantIsolation(providerCfg, iss.(string), token.Claims.(jwt.MapClaims)); err != nil {
+			reason := "policy_violation"
+			if rej, ok := err.(*securityRejection); ok {
+				reason = rej.Reason
+			}
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"issuer": iss,
+				"reason": reason,
+			}).Warning("Rejected per tenant-isolation policy: ", err)
+			k.reportLoginFailure(fmt.Sprintf("[%s] %v", reason, err), r)
+			return errors.New("Key not authorised"), 403
+		}
+	}
+
+	// 3a. Check whether the token has been revoked at the IdP since it
+	// was issued; a JWT's exp alone can't tell us that.
+	if hasProviderCfg && providerCfg.Introspection.Enabled {
+		active, err := k.introspectionCache.Active(providerCfg, extractBearerToken(r))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"issuer": iss,
+			}).Warning("Introspection check failed: ", err)
+			if providerCfg.Introspection.Required {
+				k.reportLoginFailure("[JWT]", r)
+				return errors.New("Key not authorised"), 403
+			}
+		} else if !active {
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"issuer": iss,
+			}).Warning("Token rejected: inactive per introspection")
+			k.reportLoginFailure("[JWT]", r)
+			return errors.New("Key not authorised"), 403
+		}
+	}
+
+	// 3b. Run any declarative RequiredClaims rules plus a bespoke
+	// ClaimsValidator registered by plugin middleware for this API.
+	if err := k.validateRequiredClaims(providerCfg, token.Claims.(jwt.MapClaims)); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": OIDPREFIX,
+			"issuer": iss,
+		}).Warning("Required claim validation failed: ", err)
+		k.reportLoginFailure(fmt.Sprintf("[CLAIM VALIDATION FAILED] %v", err), r)
+		return errors.New("Key not authorised"), 403
+	}
+
+	// 3c. Optionally enrich with the provider's userinfo_endpoint. The
+	// claims are used both for context/session enrichment below and as a
+	// fallback for claim-based policy mapping.
+	var userInfoClaims map[string]interface{}
+	if hasProviderCfg && providerCfg.EnableUserInfo {
+		var err error
+		userInfoClaims, err = k.fetchUserInfo(providerCfg, extractBearerToken(r))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"issuer": iss,
+			}).Warning("Fetching userinfo failed: ", err)
+		}
+	}
+
 	policyID := ""
 	clientID := ""
 	switch v := clients.(type) {
@@ -156,6 +296,35 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 		}
 	}
 
+	// 3e. Exact-audience and azp checks need clientID/clientSet from the
+	// switch above, so they run here rather than alongside 3a0.
+	if hasProviderCfg {
+		azpErr := checkAzp(providerCfg, clients, clientID, token.Claims.(jwt.MapClaims))
+		audErr := checkExactAudience(providerCfg, clients, clientSet)
+		if err := firstNonNil(audErr, azpErr); err != nil {
+			reason := "policy_violation"
+			if rej, ok := err.(*securityRejection); ok {
+				reason = rej.Reason
+			}
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"issuer": iss,
+				"reason": reason,
+			}).Warning("Rejected per tenant-isolation policy: ", err)
+			k.reportLoginFailure(fmt.Sprintf("[%s] %v", reason, err), r)
+			return errors.New("Key not authorised"), 403
+		}
+	}
+
+	// 3d. No direct client_id->policy match: fall back to claim-based
+	// policy selection against the merged id_token + userinfo claims.
+	if policyID == "" && hasProviderCfg && len(providerCfg.ClaimPolicyMap) > 0 {
+		merged := mergeClaims(token.Claims.(jwt.MapClaims), userInfoClaims)
+		if pid, ok := evaluateClaimPolicyMap(providerCfg.ClaimPolicyMap, merged); ok {
+			policyID = pid
+		}
+	}
+
 	if policyID == "" {
 		log.WithFields(logrus.Fields{
 			"prefix": OIDPREFIX,
@@ -196,6 +365,9 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 
 		sessionState = newSessionState
 		sessionState.MetaData = map[string]interface{}{"TykJWTSessionID": sessionID, "ClientID": clientID}
+		for claimName, claimValue := range userInfoClaims {
+			sessionState.MetaData["oidc_userinfo_"+claimName] = claimValue
+		}
 		sessionState.Alias = clientID + ":" + user.ID
 
 		// Update the session in the session manager in case it gets called again
@@ -210,11 +382,150 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 		context.Set(r, SessionData, sessionState)
 		context.Set(r, AuthHeaderValue, sessionID)
 	}
-	k.setContextVars(r, token)
+	k.setContextVars(r, token, userInfoClaims)
 
 	return nil, 200
 }
 
+// enforceTenantIsolation runs the issuer-allowlist, token-lifetime and
+// nonce-replay checks that don't depend on which client_id the token
+// matched against. checkExactAudience and checkAzp run separately, once
+// the aud match has been resolved.
+func (k *OpenIDMW) enforceTenantIsolation(cfg apidef.OIDProviderConfig, iss string, claims jwt.MapClaims) error {
+	if err := checkIssuerAllowlist(cfg, iss); err != nil {
+		return err
+	}
+	if err := checkTokenLifetime(cfg, claims); err != nil {
+		return err
+	}
+	if err := checkNonceReplay(cfg, claims, k.nonceStore); err != nil {
+		return err
+	}
+	return nil
+}
+
+func firstNonNil(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRequiredClaims runs the provider's declarative RequiredClaims
+// rules, then any ClaimsValidator a Go-plugin registered for this API.
+func (k *OpenIDMW) validateRequiredClaims(cfg apidef.OIDProviderConfig, claims jwt.MapClaims) error {
+	if len(cfg.RequiredClaims) > 0 {
+		validator := &requiredClaimsValidator{rules: cfg.RequiredClaims}
+		if err := validator.Validate(claims); err != nil {
+			return err
+		}
+	}
+
+	if custom, ok := lookupCustomClaimsValidator(k.Spec.APIDefinition.APIID); ok {
+		if err := custom.Validate(claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchUserInfo resolves the provider's userinfo_endpoint (via the cached
+// discovery document) and returns the cached/fetched claims for rawToken.
+func (k *OpenIDMW) fetchUserInfo(cfg apidef.OIDProviderConfig, rawToken string) (map[string]interface{}, error) {
+	if rawToken == "" {
+		return nil, errors.New("no bearer token present")
+	}
+
+	timeout := httpTimeout(cfg.HTTPTimeout)
+
+	doc, err := k.jwksManager.DiscoveryDocument(cfg.Issuer, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if doc.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("issuer %q has no userinfo_endpoint", cfg.Issuer)
+	}
+
+	ttl := time.Duration(cfg.UserInfoCacheTTL) * time.Second
+	return k.userInfoCache.Get(doc.UserInfoEndpoint, rawToken, ttl, timeout)
+}
+
+// verifyJWKSSignature independently verifies the bearer token's signature
+// against the issuer's JWKS, used to back RS256/384/512 and ES256/384/512
+// tokens with real key rotation instead of whatever openid2go would do by
+// default. Providers that Tyk has no configuration for are left to
+// openid2go's own validation.
+func (k *OpenIDMW) verifyJWKSSignature(r *http.Request) error {
+	raw := extractBearerToken(r)
+	if raw == "" {
+		return nil
+	}
+
+	// Parse without verifying to read the issuer claim; the signature is
+	// checked in the Keyfunc below.
+	parser := &jwt.Parser{}
+	unverified, _, err := parser.ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		return nil // malformed token: let openid2go produce the error
+	}
+
+	iss, _ := unverified.Claims.(jwt.MapClaims)["iss"].(string)
+	if iss == "" {
+		return nil
+	}
+
+	k.lock.RLock()
+	cfg, found := k.providerConfigByIssuer[iss]
+	k.lock.RUnlock()
+	if !found {
+		return nil
+	}
+	if !jwksSignatureCheckEnabled(cfg) {
+		// Operator hasn't opted into JWKS-backed signature validation for
+		// this provider: leave verification to openid2go as before, rather
+		// than silently requiring network access to a JWKS endpoint and
+		// restricting algorithms to defaultAllowedAlgorithms for every
+		// already-registered provider.
+		return nil
+	}
+
+	keyConfig := newProviderKeyConfig(cfg)
+	_, err = jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		alg, _ := token.Header["alg"].(string)
+		kid, _ := token.Header["kid"].(string)
+		return k.jwksManager.GetKey(keyConfig, kid, alg)
+	})
+	if err != nil {
+		return fmt.Errorf("JWKS signature validation failed for issuer %q: %v", iss, err)
+	}
+	return nil
+}
+
+// jwksSignatureCheckEnabled reports whether a provider has actually opted
+// into JWKS-backed signature validation, rather than just being registered.
+// Without this, every provider configured before this feature existed would
+// gain a new hard network dependency on its JWKS endpoint and a new
+// restriction to defaultAllowedAlgorithms, with no migration path.
+func jwksSignatureCheckEnabled(cfg apidef.OIDProviderConfig) bool {
+	return cfg.JWKSURL != "" || cfg.JWKSCacheTTL != 0 || len(cfg.AllowedAlgorithms) > 0
+}
+
+// extractBearerToken pulls the raw JWT out of the Authorization header.
+func extractBearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return ""
+	}
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
 func (k *OpenIDMW) reportLoginFailure(tykId string, r *http.Request) {
 	log.WithFields(logrus.Fields{
 		"prefix": OIDPREFIX,
@@ -228,7 +539,7 @@ func (k *OpenIDMW) reportLoginFailure(tykId string, r *http.Request) {
 	ReportHealthCheckValue(k.Spec.Health, KeyFailure, "1")
 }
 
-func (k *OpenIDMW) setContextVars(r *http.Request, token *jwt.Token) {
+func (k *OpenIDMW) setContextVars(r *http.Request, token *jwt.Token, userInfoClaims map[string]interface{}) {
 	// Flatten claims and add to context
 	if k.Spec.EnableContextVars {
 		cnt, contextFound := context.GetOk(r, ContextData)
@@ -242,6 +553,10 @@ func (k *OpenIDMW) setContextVars(r *http.Request, token *jwt.Token) {
 				contextDataObject[claim] = claimValue
 			}
 
+			for claimName, claimValue := range userInfoClaims {
+				contextDataObject["oidc_userinfo_"+claimName] = claimValue
+			}
+
 			// Key data
 			authHeaderValue := context.Get(r, AuthHeaderValue)
 			contextDataObject["token"] = authHeaderValue
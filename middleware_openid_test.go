@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestJWKSSignatureCheckEnabledRequiresOptIn(t *testing.T) {
+	if jwksSignatureCheckEnabled(apidef.OIDProviderConfig{}) {
+		t.Fatal("a provider with no JWKS settings must not be signature-checked")
+	}
+
+	if !jwksSignatureCheckEnabled(apidef.OIDProviderConfig{JWKSURL: "https://idp.example/jwks"}) {
+		t.Fatal("JWKSURL alone should opt a provider in")
+	}
+	if !jwksSignatureCheckEnabled(apidef.OIDProviderConfig{JWKSCacheTTL: 3600}) {
+		t.Fatal("JWKSCacheTTL alone should opt a provider in")
+	}
+	if !jwksSignatureCheckEnabled(apidef.OIDProviderConfig{AllowedAlgorithms: []string{"RS256"}}) {
+		t.Fatal("AllowedAlgorithms alone should opt a provider in")
+	}
+}
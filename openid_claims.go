@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// ClaimsValidator is the extension point for validating claims beyond the
+// iss/aud checks OpenIDMW already performs. It is satisfied both by the
+// declarative apidef.ClaimRule validator built from RequiredClaims, and by
+// bespoke validators registered by Go-plugin middleware via
+// RegisterClaimsValidator.
+type ClaimsValidator interface {
+	Validate(claims jwt.MapClaims) error
+}
+
+var (
+	customClaimsValidatorsMu sync.RWMutex
+	customClaimsValidators   = map[string]ClaimsValidator{}
+)
+
+// RegisterClaimsValidator installs a bespoke ClaimsValidator for the given
+// API ID. Go-plugin (.so) middleware compiled against this package calls
+// this at bootstrap (e.g. from an init() or plugin entrypoint) to enforce
+// validation rules that can't be expressed declaratively via
+// apidef.OIDProviderConfig.RequiredClaims.
+func RegisterClaimsValidator(apiID string, validator ClaimsValidator) {
+	customClaimsValidatorsMu.Lock()
+	defer customClaimsValidatorsMu.Unlock()
+	customClaimsValidators[apiID] = validator
+}
+
+func lookupCustomClaimsValidator(apiID string) (ClaimsValidator, bool) {
+	customClaimsValidatorsMu.RLock()
+	defer customClaimsValidatorsMu.RUnlock()
+	v, ok := customClaimsValidators[apiID]
+	return v, ok
+}
+
+// requiredClaimsValidator enforces an ordered list of apidef.ClaimRule
+// assertions; every rule must pass.
+type requiredClaimsValidator struct {
+	rules []apidef.ClaimRule
+}
+
+func (v *requiredClaimsValidator) Validate(claims jwt.MapClaims) error {
+	for _, rule := range v.rules {
+		val, found := dottedClaim(map[string]interface{}(claims), rule.Path)
+
+		switch rule.Operator {
+		case "exists":
+			if !found {
+				return fmt.Errorf("required claim %q is missing", rule.Path)
+			}
+		case "equals":
+			if !found || fmt.Sprintf("%v", val) != rule.Value {
+				return fmt.Errorf("claim %q does not equal %q", rule.Path, rule.Value)
+			}
+		case "contains":
+			if !found || !claimValueMatches(val, rule.Value) {
+				return fmt.Errorf("claim %q does not contain %q", rule.Path, rule.Value)
+			}
+		case "oneOf":
+			matched := false
+			if found {
+				for _, want := range rule.Values {
+					if claimValueMatches(val, want) {
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				return fmt.Errorf("claim %q did not match any of %v", rule.Path, rule.Values)
+			}
+		case "regex":
+			if !found {
+				return fmt.Errorf("required claim %q is missing", rule.Path)
+			}
+			re, err := regexp.Compile(rule.Value)
+			if err != nil {
+				return fmt.Errorf("invalid regex %q for claim %q: %v", rule.Value, rule.Path, err)
+			}
+			if !re.MatchString(fmt.Sprintf("%v", val)) {
+				return fmt.Errorf("claim %q does not match regex %q", rule.Path, rule.Value)
+			}
+		default:
+			return fmt.Errorf("unknown claim rule operator %q for claim %q", rule.Operator, rule.Path)
+		}
+	}
+	return nil
+}
+
+// dottedClaim resolves a dotted path (e.g. "realm_access.roles") against a
+// claims map, descending through nested maps one segment at a time.
+func dottedClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	var current interface{} = claims
+
+	for _, segment := range segments {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[segment]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestRequiredClaimsValidatorContainsScope(t *testing.T) {
+	validator := &requiredClaimsValidator{rules: []apidef.ClaimRule{
+		{Path: "scope", Operator: "contains", Value: "admin"},
+	}}
+
+	claims := jwt.MapClaims{"scope": "openid profile admin"}
+	if err := validator.Validate(claims); err != nil {
+		t.Fatalf("expected space-delimited scope containing %q to satisfy contains, got error: %v", "admin", err)
+	}
+
+	claims = jwt.MapClaims{"scope": "openid profile"}
+	if err := validator.Validate(claims); err == nil {
+		t.Fatal("expected contains to fail when the value is absent from scope")
+	}
+}
+
+func TestRequiredClaimsValidatorOperators(t *testing.T) {
+	claims := jwt.MapClaims{
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"admin", "editor"},
+		},
+		"email": "alice@example.com",
+	}
+
+	cases := []struct {
+		name    string
+		rule    apidef.ClaimRule
+		wantErr bool
+	}{
+		{"exists ok", apidef.ClaimRule{Path: "email", Operator: "exists"}, false},
+		{"exists missing", apidef.ClaimRule{Path: "missing", Operator: "exists"}, true},
+		{"equals ok", apidef.ClaimRule{Path: "email", Operator: "equals", Value: "alice@example.com"}, false},
+		{"equals mismatch", apidef.ClaimRule{Path: "email", Operator: "equals", Value: "bob@example.com"}, true},
+		{"contains array ok", apidef.ClaimRule{Path: "realm_access.roles", Operator: "contains", Value: "editor"}, false},
+		{"contains array missing", apidef.ClaimRule{Path: "realm_access.roles", Operator: "contains", Value: "owner"}, true},
+		{"oneOf ok", apidef.ClaimRule{Path: "email", Operator: "oneOf", Values: []string{"bob@example.com", "alice@example.com"}}, false},
+		{"oneOf mismatch", apidef.ClaimRule{Path: "email", Operator: "oneOf", Values: []string{"bob@example.com"}}, true},
+		{"regex ok", apidef.ClaimRule{Path: "email", Operator: "regex", Value: "^alice@"}, false},
+		{"regex mismatch", apidef.ClaimRule{Path: "email", Operator: "regex", Value: "^bob@"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			validator := &requiredClaimsValidator{rules: []apidef.ClaimRule{tc.rule}}
+			err := validator.Validate(claims)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
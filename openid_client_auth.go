@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+const clientAssertionLifetime = 120 * time.Second
+
+// cachedClientToken is Tyk's own access token for a provider, obtained via
+// client_secret_basic or private_key_jwt and shared by the introspection
+// and JWKS-fetch HTTP clients for that issuer. Userinfo calls do not use
+// it; they carry the incoming request's bearer token.
+type cachedClientToken struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+// ClientAuthManager authenticates Tyk to an OIDC provider as a confidential
+// client, caching the resulting access token per issuer and refreshing it
+// on expiry or a 401 from a downstream call.
+type ClientAuthManager struct {
+	mu     sync.Mutex
+	tokens map[string]*cachedClientToken
+	client *http.Client
+	disco  *JWKSManager
+}
+
+func newClientAuthManager(disco *JWKSManager) *ClientAuthManager {
+	return &ClientAuthManager{
+		tokens: make(map[string]*cachedClientToken),
+		client: &http.Client{},
+		disco:  disco,
+	}
+}
+
+// Token returns a cached or freshly obtained access token for cfg's
+// issuer. Pass forceRefresh=true after a downstream 401 to discard any
+// cached token and re-authenticate.
+func (m *ClientAuthManager) Token(cfg apidef.OIDProviderConfig, forceRefresh bool) (string, error) {
+	if cfg.ClientAuth.Mode == "" {
+		return "", nil
+	}
+
+	m.mu.Lock()
+	cached, ok := m.tokens[cfg.Issuer]
+	m.mu.Unlock()
+	if ok && !forceRefresh && time.Now().Before(cached.expiresAt) {
+		return cached.accessToken, nil
+	}
+
+	timeout := httpTimeout(cfg.HTTPTimeout)
+
+	tokenEndpoint := cfg.ClientAuth.TokenEndpoint
+	if tokenEndpoint == "" {
+		doc, err := m.disco.DiscoveryDocument(cfg.Issuer, timeout)
+		if err != nil {
+			return "", fmt.Errorf("resolving token_endpoint for %q: %v", cfg.Issuer, err)
+		}
+		tokenEndpoint = doc.TokenEndpoint
+	}
+	if tokenEndpoint == "" {
+		return "", fmt.Errorf("no token_endpoint available for issuer %q", cfg.Issuer)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(cfg.ClientAuth.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.ClientAuth.Scopes, " "))
+	}
+
+	var useBasicAuth bool
+	switch cfg.ClientAuth.Mode {
+	case "client_secret_basic":
+		useBasicAuth = true
+	case "private_key_jwt":
+		assertion, err := buildClientAssertion(cfg.ClientAuth, tokenEndpoint)
+		if err != nil {
+			return "", fmt.Errorf("building client assertion: %v", err)
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	default:
+		return "", fmt.Errorf("unsupported client auth mode %q", cfg.ClientAuth.Mode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("building token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if useBasicAuth {
+		req.SetBasicAuth(cfg.ClientAuth.ClientID, cfg.ClientAuth.ClientSecret)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("calling token endpoint %q: %v", tokenEndpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint %q returned status %d", tokenEndpoint, resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decoding token response: %v", err)
+	}
+	if result.ExpiresIn <= 0 {
+		result.ExpiresIn = 60
+	}
+
+	m.mu.Lock()
+	m.tokens[cfg.Issuer] = &cachedClientToken{
+		accessToken: result.AccessToken,
+		expiresAt:   time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}
+	m.mu.Unlock()
+
+	return result.AccessToken, nil
+}
+
+// buildClientAssertion signs a short-lived JWT asserting Tyk's identity to
+// the provider, per the private_key_jwt client authentication method.
+func buildClientAssertion(cfg apidef.ClientAuthConfig, audience string) (string, error) {
+	signer, kid, err := loadClientSigningKey(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("generating jti: %v", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": cfg.ClientID,
+		"sub": cfg.ClientID,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	return token.SignedString(signer)
+}
+
+// loadClientSigningKey loads the RSA private key used to sign client
+// assertions, either from a PEM file or from a JWK set on disk keyed by
+// KeyID.
+func loadClientSigningKey(cfg apidef.ClientAuthConfig) (*rsa.PrivateKey, string, error) {
+	if cfg.PrivateKeyFile != "" {
+		keyBytes, err := ioutil.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading private key file %q: %v", cfg.PrivateKeyFile, err)
+		}
+		block, _ := pem.Decode(keyBytes)
+		if block == nil {
+			return nil, "", fmt.Errorf("no PEM block found in %q", cfg.PrivateKeyFile)
+		}
+		key, err := parseRSAPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		return key, cfg.KeyID, nil
+	}
+
+	if cfg.JWKSFile != "" {
+		keyBytes, err := ioutil.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading JWKS file %q: %v", cfg.JWKSFile, err)
+		}
+		var set struct {
+			Keys []struct {
+				Kid string `json:"kid"`
+				N   string `json:"n"`
+				E   string `json:"e"`
+				D   string `json:"d"`
+				P   string `json:"p"`
+				Q   string `json:"q"`
+			} `json:"keys"`
+		}
+		if err := json.Unmarshal(keyBytes, &set); err != nil {
+			return nil, "", fmt.Errorf("decoding JWKS file %q: %v", cfg.JWKSFile, err)
+		}
+		for _, k := range set.Keys {
+			if cfg.KeyID != "" && k.Kid != cfg.KeyID {
+				continue
+			}
+			key, err := rsaPrivateKeyFromJWK(k.N, k.E, k.D, k.P, k.Q)
+			if err != nil {
+				return nil, "", err
+			}
+			return key, k.Kid, nil
+		}
+		return nil, "", fmt.Errorf("kid %q not found in %q", cfg.KeyID, cfg.JWKSFile)
+	}
+
+	return nil, "", fmt.Errorf("private_key_jwt requires PrivateKeyFile or JWKSFile")
+}
+
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing RSA private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("PKCS8 key is not an RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// rsaPrivateKeyFromJWK builds an *rsa.PrivateKey from a JWK's RSA fields.
+// pb64/qb64 (the "p"/"q" prime factors) are required: without them
+// key.Primes is empty, so key.Validate's N == product(Primes) check fails
+// for every real key, and Precompute has nothing to compute CRT values
+// from.
+func rsaPrivateKeyFromJWK(nb64, eb64, db64, pb64, qb64 string) (*rsa.PrivateKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(nb64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWK modulus: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(eb64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWK exponent: %v", err)
+	}
+	d, err := base64.RawURLEncoding.DecodeString(db64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWK private exponent: %v", err)
+	}
+	if pb64 == "" || qb64 == "" {
+		return nil, fmt.Errorf("JWK is missing the \"p\"/\"q\" prime factors required to build a usable private key")
+	}
+	p, err := base64.RawURLEncoding.DecodeString(pb64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWK prime p: %v", err)
+	}
+	q, err := base64.RawURLEncoding.DecodeString(qb64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWK prime q: %v", err)
+	}
+
+	eInt := 0
+	for _, b := range e {
+		eInt = eInt<<8 | int(b)
+	}
+
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: eInt,
+		},
+		D:      new(big.Int).SetBytes(d),
+		Primes: []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("validating JWK-derived RSA key: %v", err)
+	}
+	key.Precompute()
+	return key, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestRSAPrivateKeyFromJWKRoundTrip(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	eBytes := big.NewInt(int64(priv.E)).Bytes()
+
+	key, err := rsaPrivateKeyFromJWK(
+		enc(priv.N.Bytes()),
+		enc(eBytes),
+		enc(priv.D.Bytes()),
+		enc(priv.Primes[0].Bytes()),
+		enc(priv.Primes[1].Bytes()),
+	)
+	if err != nil {
+		t.Fatalf("rsaPrivateKeyFromJWK: %v", err)
+	}
+	if key.N.Cmp(priv.N) != 0 {
+		t.Fatal("decoded modulus does not match original key")
+	}
+}
+
+func TestRSAPrivateKeyFromJWKMissingPrimes(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	eBytes := big.NewInt(int64(priv.E)).Bytes()
+
+	if _, err := rsaPrivateKeyFromJWK(enc(priv.N.Bytes()), enc(eBytes), enc(priv.D.Bytes()), "", ""); err == nil {
+		t.Fatal("expected an error when p/q are absent from the JWK")
+	}
+}
+
+func TestLoadClientSigningKeyFromJWKSFile(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	eBytes := big.NewInt(int64(priv.E)).Bytes()
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "sig-1",
+			"n":   enc(priv.N.Bytes()),
+			"e":   enc(eBytes),
+			"d":   enc(priv.D.Bytes()),
+			"p":   enc(priv.Primes[0].Bytes()),
+			"q":   enc(priv.Primes[1].Bytes()),
+		}},
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("marshaling JWKS: %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "jwks-*.json")
+	if err != nil {
+		t.Fatalf("creating temp JWKS file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("writing temp JWKS file: %v", err)
+	}
+	f.Close()
+
+	key, kid, err := loadClientSigningKey(apidef.ClientAuthConfig{JWKSFile: f.Name(), KeyID: "sig-1"})
+	if err != nil {
+		t.Fatalf("loadClientSigningKey: %v", err)
+	}
+	if kid != "sig-1" {
+		t.Fatalf("expected kid %q, got %q", "sig-1", kid)
+	}
+	if key.N.Cmp(priv.N) != 0 {
+		t.Fatal("loaded key modulus does not match original key")
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	introspectionCachePrefix   = "oidc-introspect-"
+	introspectionSweepInterval = time.Minute
+)
+
+// introspectionStore is the storage backend used to cache introspection
+// results, keyed by a hash of the token. OpenIDMW.New() backs it with
+// sharedInMemoryStore(), which is process-local: results are not shared
+// across gateway nodes or with Tyk's Redis storage.
+type introspectionStore interface {
+	GetKey(key string) (string, error)
+	SetKey(key, value string, ttlSeconds int64) error
+}
+
+// IntrospectionCache performs RFC 7662 introspection calls against an OIDC
+// provider, caching results in storage and coalescing concurrent lookups
+// for the same token so that a burst of requests for one token only costs
+// a single round-trip to the IdP.
+type IntrospectionCache struct {
+	storage introspectionStore
+	client  *http.Client
+	auth    *ClientAuthManager
+
+	mu       sync.Mutex
+	inflight map[string]*introspectionCall
+}
+
+type introspectionCall struct {
+	wg     sync.WaitGroup
+	active bool
+	err    error
+}
+
+func newIntrospectionCache(storage introspectionStore, auth *ClientAuthManager) *IntrospectionCache {
+	return &IntrospectionCache{
+		storage:  storage,
+		client:   &http.Client{},
+		auth:     auth,
+		inflight: make(map[string]*introspectionCall),
+	}
+}
+
+// Active reports whether rawToken is still active per the provider's
+// introspection endpoint, serving from cache where possible.
+func (c *IntrospectionCache) Active(provider apidef.OIDProviderConfig, rawToken string) (bool, error) {
+	key := introspectionCachePrefix + fmt.Sprintf("%x", md5.Sum([]byte(rawToken)))
+
+	if cached, err := c.storage.GetKey(key); err == nil {
+		return cached == "active", nil
+	}
+
+	c.mu.Lock()
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.active, call.err
+	}
+
+	call := &introspectionCall{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	active, ttl, err := c.introspect(provider, rawToken)
+	call.active, call.err = active, err
+
+	// Cache the result before dropping the inflight entry, so a request
+	// arriving in between finds it in storage instead of calling again.
+	if err == nil {
+		value := "inactive"
+		if active {
+			value = "active"
+		}
+		if setErr := c.storage.SetKey(key, value, ttl); setErr != nil {
+			log.Warning("Failed to cache introspection result: ", setErr)
+		}
+	}
+	call.wg.Done()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	return active, err
+}
+
+// introspect calls the provider's introspection endpoint and returns the
+// active flag plus the cache TTL to apply, which is min(cfg.CacheTTL,
+// exp-now) when the response carries an "exp" claim. Authentication
+// prefers the introspection-specific client_id/secret; when those are
+// absent and the provider has ClientAuth configured (e.g. private_key_jwt,
+// which has no static secret), the shared client access token is used
+// instead, with one retry after a 401 forces a refresh.
+func (c *IntrospectionCache) introspect(provider apidef.OIDProviderConfig, rawToken string) (bool, int64, error) {
+	cfg := provider.Introspection
+	useOwnCreds := cfg.ClientID != ""
+
+	result, status, err := c.doIntrospect(cfg, provider, rawToken, useOwnCreds, false)
+	if status == http.StatusUnauthorized && !useOwnCreds {
+		result, _, err = c.doIntrospect(cfg, provider, rawToken, useOwnCreds, true)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = int64(defaultUserInfoCacheTTL.Seconds())
+	}
+	if result.Exp > 0 {
+		if remaining := result.Exp - time.Now().Unix(); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return result.Active, ttl, nil
+}
+
+type introspectionResponse struct {
+	Active bool  `json:"active"`
+	Exp    int64 `json:"exp"`
+}
+
+func (c *IntrospectionCache) doIntrospect(cfg apidef.IntrospectionConfig, provider apidef.OIDProviderConfig, rawToken string, useOwnCreds, forceRefresh bool) (introspectionResponse, int, error) {
+	form := url.Values{}
+	form.Set("token", rawToken)
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout(provider.HTTPTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return introspectionResponse{}, 0, fmt.Errorf("building introspection request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if useOwnCreds {
+		req.SetBasicAuth(cfg.ClientID, cfg.ClientSecret)
+	} else if c.auth != nil && provider.ClientAuth.Mode != "" {
+		token, err := c.auth.Token(provider, forceRefresh)
+		if err != nil {
+			return introspectionResponse{}, 0, fmt.Errorf("obtaining client token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return introspectionResponse{}, 0, fmt.Errorf("calling introspection endpoint %q: %v", cfg.Endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return introspectionResponse{}, resp.StatusCode, fmt.Errorf("introspection endpoint %q returned status %d", cfg.Endpoint, resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return introspectionResponse{}, resp.StatusCode, fmt.Errorf("decoding introspection response: %v", err)
+	}
+	return result, resp.StatusCode, nil
+}
+
+// inMemoryIntrospectionStore is a single-process stand-in for a shared
+// storage backend (e.g. Redis). It does NOT share state across gateway
+// nodes: a token revoked at the IdP only stops working on the node whose
+// introspection call observed the revocation, and jti replay detection
+// only catches a replay that lands back on the same process. Do not rely
+// on Introspection.Required or RequireNonce to hold those guarantees
+// across a multi-node gateway until this is backed by Tyk's shared
+// Redis-backed storage.Handler (the same handle SessionManager uses).
+//
+// This is also the cache backing both introspection results and nonce
+// replay tracking, i.e. it sits on the hot path of the high-token-volume
+// workloads those two features protect; a background sweep evicts expired
+// entries so entries don't accumulate without bound under real traffic.
+type inMemoryIntrospectionStore struct {
+	mu      sync.Mutex
+	entries map[string]inMemoryEntry
+	done    chan struct{}
+}
+
+type inMemoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newInMemoryIntrospectionStore() *inMemoryIntrospectionStore {
+	s := &inMemoryIntrospectionStore{
+		entries: make(map[string]inMemoryEntry),
+		done:    make(chan struct{}),
+	}
+	go s.sweepLoop()
+	return s
+}
+
+// Stop ends the background sweep goroutine.
+func (s *inMemoryIntrospectionStore) Stop() {
+	close(s.done)
+}
+
+func (s *inMemoryIntrospectionStore) sweepLoop() {
+	ticker := time.NewTicker(introspectionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *inMemoryIntrospectionStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+var (
+	sharedInMemoryStoreOnce sync.Once
+	sharedInMemoryStoreInst *inMemoryIntrospectionStore
+)
+
+// sharedInMemoryStore returns a process-wide instance, reused across every
+// OpenIDMW.New() call (a fresh store per call would otherwise wipe
+// introspection-cache and nonce-replay state on every API reload, even
+// within a single node).
+func sharedInMemoryStore() *inMemoryIntrospectionStore {
+	sharedInMemoryStoreOnce.Do(func() {
+		sharedInMemoryStoreInst = newInMemoryIntrospectionStore()
+	})
+	return sharedInMemoryStoreInst
+}
+
+func (s *inMemoryIntrospectionStore) GetKey(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+	return entry.value, nil
+}
+
+func (s *inMemoryIntrospectionStore) SetKey(key, value string, ttlSeconds int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = inMemoryEntry{value: value, expiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second)}
+	return nil
+}
+
+// SetNX sets key only if it is not already present and unexpired,
+// reporting whether the set happened. It also backs nonce-replay
+// detection (see replayStore), for the same reason it backs introspection
+// caching: a single in-memory stand-in for Tyk's shared Redis storage.
+func (s *inMemoryIntrospectionStore) SetNX(key, value string, ttlSeconds int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok && time.Now().Before(entry.expiresAt) {
+		return false, nil
+	}
+	s.entries[key] = inMemoryEntry{value: value, expiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second)}
+	return true, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestIntrospectionCacheActiveReturnsInactive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"active":false}`)
+	}))
+	defer srv.Close()
+
+	cache := newIntrospectionCache(newInMemoryIntrospectionStore(), nil)
+	provider := apidef.OIDProviderConfig{
+		Introspection: apidef.IntrospectionConfig{Endpoint: srv.URL, ClientID: "tyk", ClientSecret: "secret"},
+	}
+
+	active, err := cache.Active(provider, "sometoken")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if active {
+		t.Fatal("expected token to be reported inactive")
+	}
+}
+
+func TestIntrospectionCacheActiveReturnsActive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"active":true}`)
+	}))
+	defer srv.Close()
+
+	cache := newIntrospectionCache(newInMemoryIntrospectionStore(), nil)
+	provider := apidef.OIDProviderConfig{
+		Introspection: apidef.IntrospectionConfig{Endpoint: srv.URL, ClientID: "tyk", ClientSecret: "secret"},
+	}
+
+	active, err := cache.Active(provider, "sometoken")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !active {
+		t.Fatal("expected token to be reported active")
+	}
+}
+
+// TestIntrospectionCacheActiveErrorsWhenUnreachable verifies Active
+// surfaces a non-nil error rather than defaulting to active when the
+// introspection endpoint can't be reached. ProcessRequest uses this error
+// to decide fail-open vs fail-closed via Introspection.Required.
+func TestIntrospectionCacheActiveErrorsWhenUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	srv.Close() // closed immediately: connections to it fail
+
+	cache := newIntrospectionCache(newInMemoryIntrospectionStore(), nil)
+	provider := apidef.OIDProviderConfig{
+		Introspection: apidef.IntrospectionConfig{Endpoint: srv.URL, ClientID: "tyk", ClientSecret: "secret"},
+	}
+
+	if _, err := cache.Active(provider, "sometoken"); err == nil {
+		t.Fatal("expected an error when the introspection endpoint is unreachable")
+	}
+}
+
+// TestInMemoryIntrospectionStoreSweepEvictsExpiredEntries verifies that
+// entries are reclaimed once expired, rather than accumulating forever --
+// this store backs both the introspection cache and the nonce-replay store,
+// both of which get one entry per distinct token/jti seen.
+func TestInMemoryIntrospectionStoreSweepEvictsExpiredEntries(t *testing.T) {
+	s := newInMemoryIntrospectionStore()
+	defer s.Stop()
+
+	if err := s.SetKey("stale", "active", 0); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	if err := s.SetKey("fresh", "active", 3600); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+
+	s.mu.Lock()
+	entry := s.entries["stale"]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	s.entries["stale"] = entry
+	s.mu.Unlock()
+
+	s.sweep()
+
+	s.mu.Lock()
+	_, staleStillPresent := s.entries["stale"]
+	_, freshStillPresent := s.entries["fresh"]
+	s.mu.Unlock()
+
+	if staleStillPresent {
+		t.Fatal("expected the expired entry to be evicted by sweep")
+	}
+	if !freshStillPresent {
+		t.Fatal("expected the unexpired entry to survive sweep")
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	defaultJWKSCacheTTL    = time.Hour
+	minJWKSRefreshInterval = 5 * time.Minute
+	defaultJWKSHTTPTimeout = 10 * time.Second
+	discoveryCacheTTL      = time.Hour
+)
+
+var defaultAllowedAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// httpTimeout returns the operator-configured HTTPTimeout (in seconds) as a
+// Duration, falling back to defaultJWKSHTTPTimeout when unset.
+func httpTimeout(seconds int64) time.Duration {
+	if seconds <= 0 {
+		return defaultJWKSHTTPTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// discoveryDocument is the subset of an OpenID Connect discovery document
+// (".well-known/openid-configuration") that the OpenID middleware cares
+// about.
+type discoveryDocument struct {
+	JWKSURI               string `json:"jwks_uri"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// issuerKeySet is the cached, decoded key material for a single issuer.
+type issuerKeySet struct {
+	keys        map[string]interface{} // kid -> *rsa.PublicKey / *ecdsa.PublicKey
+	jwksURI     string
+	fetchedAt   time.Time
+	lastRefresh time.Time
+}
+
+// JWKSManager fetches, caches and rotates JWT signing keys for the OIDC
+// providers configured on an API. Keys are cached per-issuer, and once a
+// set is cached a kid miss refetches it at most once per
+// minJWKSRefreshInterval. Concurrent lookups are not coalesced: lookups
+// that miss before a fetch has completed each fetch. It also caches each
+// issuer's discovery document, since the JWKS, userinfo and token
+// endpoints are all resolved from the same document.
+type JWKSManager struct {
+	mu         sync.RWMutex
+	sets       map[string]*issuerKeySet
+	ticking    map[string]bool
+	discoCache map[string]*cachedDiscoveryDocument
+	client     *http.Client
+
+	// auth authenticates JWKS fetches for providers whose JWKSURL sits
+	// behind auth (confidential clients). Wired in after construction to
+	// avoid a JWKSManager<->ClientAuthManager cycle.
+	auth *ClientAuthManager
+
+	// done stops every background rotation goroutine started by
+	// startRotation when closed. OpenIDMW.New() builds a fresh
+	// JWKSManager on every API reload, so it must Stop() the manager it
+	// is replacing or each reload leaks one goroutine per issuer.
+	done chan struct{}
+}
+
+// SetClientAuthManager wires in the shared client-credential manager used
+// to authenticate JWKS fetches for providers with ClientAuth configured.
+func (m *JWKSManager) SetClientAuthManager(auth *ClientAuthManager) {
+	m.auth = auth
+}
+
+// Stop ends all background key-rotation goroutines started for this
+// manager. Call it before discarding a JWKSManager, e.g. when New()
+// replaces it on an API reload.
+func (m *JWKSManager) Stop() {
+	close(m.done)
+}
+
+type cachedDiscoveryDocument struct {
+	doc       *discoveryDocument
+	fetchedAt time.Time
+}
+
+func newJWKSManager() *JWKSManager {
+	return &JWKSManager{
+		sets:       make(map[string]*issuerKeySet),
+		ticking:    make(map[string]bool),
+		discoCache: make(map[string]*cachedDiscoveryDocument),
+		client:     &http.Client{},
+		done:       make(chan struct{}),
+	}
+}
+
+// DiscoveryDocument returns the (possibly cached) discovery document for an
+// issuer, bounding any network fetch by timeout.
+func (m *JWKSManager) DiscoveryDocument(issuer string, timeout time.Duration) (*discoveryDocument, error) {
+	return m.getDiscoveryDocument(issuer, timeout)
+}
+
+func (m *JWKSManager) getDiscoveryDocument(issuer string, timeout time.Duration) (*discoveryDocument, error) {
+	m.mu.RLock()
+	cached := m.discoCache[issuer]
+	m.mu.RUnlock()
+	if cached != nil && time.Since(cached.fetchedAt) < discoveryCacheTTL {
+		return cached.doc, nil
+	}
+
+	doc, err := m.discover(issuer, timeout)
+	if err != nil {
+		if cached != nil {
+			// Serve the stale document rather than fail outright.
+			return cached.doc, nil
+		}
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.discoCache[issuer] = &cachedDiscoveryDocument{doc: doc, fetchedAt: time.Now()}
+	m.mu.Unlock()
+
+	return doc, nil
+}
+
+// GetKey returns the public key that should be used to verify a JWT with
+// the given kid/alg, fetching and caching the provider's JWKS as needed.
+func (m *JWKSManager) GetKey(cfg providerKeyConfig, kid, alg string) (interface{}, error) {
+	if !algAllowed(alg, cfg.AllowedAlgorithms) {
+		return nil, fmt.Errorf("algorithm %q is not permitted for issuer %q", alg, cfg.Issuer)
+	}
+	if kid == "" {
+		return nil, errors.New("token header is missing kid")
+	}
+
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+
+	m.mu.RLock()
+	set := m.sets[cfg.Issuer]
+	m.mu.RUnlock()
+
+	if set != nil {
+		if key, ok := set.keys[kid]; ok && time.Since(set.fetchedAt) < ttl {
+			return key, nil
+		}
+	}
+
+	// kid miss, or no cached set yet: refresh, but bound how often we'll
+	// hit the network for a single issuer to avoid a stampede.
+	if set != nil && time.Since(set.lastRefresh) < minJWKSRefreshInterval {
+		if key, ok := set.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown kid %q for issuer %q (refreshed too recently to retry)", kid, cfg.Issuer)
+	}
+
+	refreshed, err := m.refresh(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m.startRotation(cfg)
+
+	key, ok := refreshed.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q for issuer %q", kid, cfg.Issuer)
+	}
+	return key, nil
+}
+
+func (m *JWKSManager) refresh(cfg providerKeyConfig) (*issuerKeySet, error) {
+	jwksURI := cfg.JWKSURL
+	if jwksURI == "" {
+		doc, err := m.getDiscoveryDocument(cfg.Issuer, cfg.HTTPTimeout)
+		if err != nil {
+			return nil, err
+		}
+		jwksURI = doc.JWKSURI
+	}
+	if jwksURI == "" {
+		return nil, fmt.Errorf("no jwks_uri available for issuer %q", cfg.Issuer)
+	}
+
+	keySet, err := m.fetchKeySet(jwksURI, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(keySet.Keys))
+	for _, k := range keySet.Keys {
+		pub, err := decodeJSONWebKey(k)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": OIDPREFIX,
+				"kid":    k.Kid,
+				"issuer": cfg.Issuer,
+			}).Warning("Skipping undecodable JWKS entry: ", err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	now := time.Now()
+	set := &issuerKeySet{
+		keys:        keys,
+		jwksURI:     jwksURI,
+		fetchedAt:   now,
+		lastRefresh: now,
+	}
+
+	m.mu.Lock()
+	m.sets[cfg.Issuer] = set
+	m.mu.Unlock()
+
+	return set, nil
+}
+
+// startRotation ensures exactly one background goroutine rotates keys for
+// this issuer at its configured TTL.
+func (m *JWKSManager) startRotation(cfg providerKeyConfig) {
+	m.mu.Lock()
+	if m.ticking[cfg.Issuer] {
+		m.mu.Unlock()
+		return
+	}
+	m.ticking[cfg.Issuer] = true
+	m.mu.Unlock()
+
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+
+	go func() {
+		ticker := time.NewTicker(ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+			}
+			if _, err := m.refresh(cfg); err != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": OIDPREFIX,
+					"issuer": cfg.Issuer,
+				}).Warning("Background JWKS rotation failed: ", err)
+			}
+		}
+	}()
+}
+
+func (m *JWKSManager) discover(issuer string, timeout time.Duration) (*discoveryDocument, error) {
+	if timeout <= 0 {
+		timeout = defaultJWKSHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("building discovery request for %q: %v", issuer, err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document for %q: %v", issuer, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery document for %q returned status %d", issuer, resp.StatusCode)
+	}
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding discovery document for %q: %v", issuer, err)
+	}
+	return &doc, nil
+}
+
+// fetchKeySet fetches the JWKS at jwksURI, authenticating the request when
+// cfg has ClientAuth configured. A 401 triggers one bounded retry with a
+// freshly obtained access token.
+func (m *JWKSManager) fetchKeySet(jwksURI string, cfg providerKeyConfig) (*jsonWebKeySet, error) {
+	token, err := m.bearerToken(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet, status, err := m.doFetchKeySet(jwksURI, token, cfg.HTTPTimeout)
+	if status == http.StatusUnauthorized && token != "" {
+		if token, err = m.bearerToken(cfg, true); err != nil {
+			return nil, err
+		}
+		keySet, _, err = m.doFetchKeySet(jwksURI, token, cfg.HTTPTimeout)
+	}
+	return keySet, err
+}
+
+func (m *JWKSManager) doFetchKeySet(jwksURI, bearerToken string, timeout time.Duration) (*jsonWebKeySet, int, error) {
+	if timeout <= 0 {
+		timeout = defaultJWKSHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("building JWKS request: %v", err)
+	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching JWKS from %q: %v", jwksURI, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("JWKS endpoint %q returned status %d", jwksURI, resp.StatusCode)
+	}
+
+	var keySet jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("decoding JWKS from %q: %v", jwksURI, err)
+	}
+	return &keySet, resp.StatusCode, nil
+}
+
+// bearerToken returns the access token to authenticate a fetch with, or ""
+// when the provider has no ClientAuth configured.
+func (m *JWKSManager) bearerToken(cfg providerKeyConfig, forceRefresh bool) (string, error) {
+	if m.auth == nil || cfg.ClientAuth.Mode == "" {
+		return "", nil
+	}
+	return m.auth.Token(apidef.OIDProviderConfig{Issuer: cfg.Issuer, ClientAuth: cfg.ClientAuth}, forceRefresh)
+}
+
+func decodeJSONWebKey(k jsonWebKey) (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding RSA modulus: %v", err)
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding RSA exponent: %v", err)
+		}
+		e := 0
+		for _, b := range eBytes {
+			e = e<<8 | int(b)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: e,
+		}, nil
+	case "EC":
+		xBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding EC x: %v", err)
+		}
+		yBytes, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding EC y: %v", err)
+		}
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// algAllowed reports whether alg may be used to verify a token. "none" and
+// HMAC algorithms are rejected unless the operator has explicitly opted
+// in via AllowedAlgorithms.
+func algAllowed(alg string, allowed []string) bool {
+	if len(allowed) == 0 {
+		allowed = defaultAllowedAlgorithms
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
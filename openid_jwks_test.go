@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPTimeout(t *testing.T) {
+	if got := httpTimeout(0); got != defaultJWKSHTTPTimeout {
+		t.Fatalf("expected default timeout %v for unset seconds, got %v", defaultJWKSHTTPTimeout, got)
+	}
+	if got := httpTimeout(30); got != 30*time.Second {
+		t.Fatalf("expected 30s, got %v", got)
+	}
+}
+
+func TestAlgAllowed(t *testing.T) {
+	if !algAllowed("RS256", nil) {
+		t.Fatal("RS256 should be allowed by default")
+	}
+	if algAllowed("none", nil) {
+		t.Fatal("none must not be allowed unless explicitly configured")
+	}
+	if algAllowed("HS256", nil) {
+		t.Fatal("HS256 must not be allowed unless explicitly configured")
+	}
+	if !algAllowed("HS256", []string{"HS256"}) {
+		t.Fatal("HS256 should be allowed once explicitly configured")
+	}
+}
+
+// TestJWKSManagerStopEndsRotation verifies that Stop() halts a manager's
+// background rotation goroutines, so that OpenIDMW.New() (which builds a
+// fresh JWKSManager on every API reload) doesn't leak one goroutine per
+// issuer per reload.
+func TestJWKSManagerStopEndsRotation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{})
+	}))
+	defer srv.Close()
+
+	runtime.GC()
+	baseline := runtime.NumGoroutine()
+
+	m := newJWKSManager()
+	cfg := providerKeyConfig{Issuer: "https://issuer.example", JWKSURL: srv.URL, CacheTTL: 10 * time.Millisecond}
+	if _, err := m.refresh(cfg); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	m.startRotation(cfg)
+
+	time.Sleep(30 * time.Millisecond)
+	m.Stop()
+	time.Sleep(30 * time.Millisecond)
+	runtime.GC()
+
+	if got := runtime.NumGoroutine(); got > baseline+1 {
+		t.Fatalf("expected rotation goroutine to exit after Stop(), baseline=%d got=%d", baseline, got)
+	}
+}
+
+// TestGetKeyThrottlesKidMissStampede verifies that a burst of requests for
+// an unknown kid only triggers one JWKS refresh, instead of stampeding the
+// IdP once per request.
+func TestGetKeyThrottlesKidMissStampede(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{
+			{Kty: "RSA", Kid: "known", N: "AQAB", E: "AQAB"},
+		}})
+	}))
+	defer srv.Close()
+
+	m := newJWKSManager()
+	cfg := providerKeyConfig{Issuer: "https://issuer.example", JWKSURL: srv.URL, CacheTTL: time.Hour}
+
+	for i := 0; i < 5; i++ {
+		if _, err := m.GetKey(cfg, "unknown-kid", "RS256"); err == nil {
+			t.Fatal("expected an error for an unknown kid")
+		}
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected exactly 1 JWKS fetch across a stampede of kid-miss lookups, got %d", got)
+	}
+}
+
+// TestAlgRejection verifies GetKey rejects algorithms outside the allowlist
+// before ever consulting the cache or network.
+func TestAlgRejection(t *testing.T) {
+	m := newJWKSManager()
+	cfg := providerKeyConfig{Issuer: "https://issuer.example"}
+
+	if _, err := m.GetKey(cfg, "some-kid", "none"); err == nil {
+		t.Fatal("expected alg \"none\" to be rejected by default")
+	}
+	if _, err := m.GetKey(cfg, "some-kid", "HS256"); err == nil {
+		t.Fatal("expected alg \"HS256\" to be rejected by default")
+	}
+}
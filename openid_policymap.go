@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// evaluateClaimPolicyMap walks an ordered list of claim-based policy rules
+// and returns the policy ID for the first rule whose claim matches, used
+// as a fallback when no direct aud->policy match exists.
+func evaluateClaimPolicyMap(rules []apidef.ClaimPolicyRule, claims map[string]interface{}) (string, bool) {
+	for _, rule := range rules {
+		val, ok := claims[rule.Claim]
+		if !ok {
+			continue
+		}
+		if claimValueMatches(val, rule.Value) {
+			return rule.PolicyID, true
+		}
+	}
+	return "", false
+}
+
+// claimValueMatches reports whether want is equal to (for string claims) or
+// contained in (for string arrays) claimValue; claims of any other type,
+// such as numbers or booleans, never match. A string claim is treated as
+// whitespace-delimited (e.g. an OAuth2 "scope" claim like "openid profile
+// admin"), so want
+// matches if it is the whole string or one of its space-separated tokens.
+func claimValueMatches(claimValue interface{}, want string) bool {
+	switch v := claimValue.(type) {
+	case string:
+		if v == want {
+			return true
+		}
+		for _, tok := range strings.Fields(v) {
+			if tok == want {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeClaims combines id_token claims with userinfo claims, with userinfo
+// values taking precedence on key collision.
+func mergeClaims(tokenClaims map[string]interface{}, userInfoClaims map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(tokenClaims)+len(userInfoClaims))
+	for k, v := range tokenClaims {
+		merged[k] = v
+	}
+	for k, v := range userInfoClaims {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestClaimValueMatches(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  string
+		match bool
+	}{
+		{"exact string match", "admins", "admins", true},
+		{"string mismatch", "users", "admins", false},
+		{"space-delimited scope token", "openid profile admin", "admin", true},
+		{"space-delimited scope token absent", "openid profile", "admin", false},
+		{"interface slice match", []interface{}{"editor", "admins"}, "admins", true},
+		{"interface slice mismatch", []interface{}{"editor"}, "admins", false},
+		{"string slice match", []string{"editor", "admins"}, "admins", true},
+		{"unsupported type", 42, "admins", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := claimValueMatches(tc.value, tc.want); got != tc.match {
+				t.Fatalf("claimValueMatches(%v, %q) = %v, want %v", tc.value, tc.want, got, tc.match)
+			}
+		})
+	}
+}
+
+func TestEvaluateClaimPolicyMapFirstMatchWins(t *testing.T) {
+	rules := []apidef.ClaimPolicyRule{
+		{Claim: "groups", Value: "editors", PolicyID: "policy-editor"},
+		{Claim: "groups", Value: "admins", PolicyID: "policy-admin"},
+	}
+	claims := map[string]interface{}{"groups": []interface{}{"admins", "editors"}}
+
+	policyID, ok := evaluateClaimPolicyMap(rules, claims)
+	if !ok {
+		t.Fatal("expected a matching rule")
+	}
+	if policyID != "policy-editor" {
+		t.Fatalf("expected the first matching rule to win, got %q", policyID)
+	}
+}
+
+func TestEvaluateClaimPolicyMapNoMatch(t *testing.T) {
+	rules := []apidef.ClaimPolicyRule{
+		{Claim: "groups", Value: "admins", PolicyID: "policy-admin"},
+	}
+	claims := map[string]interface{}{"groups": []interface{}{"editors"}}
+
+	if _, ok := evaluateClaimPolicyMap(rules, claims); ok {
+		t.Fatal("expected no rule to match")
+	}
+
+	if _, ok := evaluateClaimPolicyMap(rules, map[string]interface{}{}); ok {
+		t.Fatal("expected a missing claim to not match")
+	}
+}
+
+func TestMergeClaimsUserInfoOverridesIDToken(t *testing.T) {
+	tokenClaims := map[string]interface{}{"email": "stale@example.com", "sub": "user-1"}
+	userInfoClaims := map[string]interface{}{"email": "fresh@example.com"}
+
+	merged := mergeClaims(tokenClaims, userInfoClaims)
+
+	if merged["email"] != "fresh@example.com" {
+		t.Fatalf("expected userinfo to override id_token on collision, got %q", merged["email"])
+	}
+	if merged["sub"] != "user-1" {
+		t.Fatalf("expected id_token-only claims to survive the merge, got %q", merged["sub"])
+	}
+}
+
+func TestMergeClaimsNilUserInfoKeepsIDTokenClaims(t *testing.T) {
+	tokenClaims := map[string]interface{}{"sub": "user-1"}
+
+	merged := mergeClaims(tokenClaims, nil)
+
+	if merged["sub"] != "user-1" {
+		t.Fatalf("expected id_token claims to pass through unchanged, got %v", merged)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestCheckNonceReplayRejectsDuplicateJTI(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{RequireNonce: true}
+	store := newInMemoryIntrospectionStore()
+	claims := jwt.MapClaims{"nonce": "n-1", "jti": "jti-1", "exp": float64(9999999999)}
+
+	if err := checkNonceReplay(cfg, claims, store); err != nil {
+		t.Fatalf("expected first use to be accepted, got: %v", err)
+	}
+	if err := checkNonceReplay(cfg, claims, store); err == nil {
+		t.Fatal("expected a replayed jti to be rejected")
+	} else if rej, ok := err.(*securityRejection); !ok || rej.Reason != "replay" {
+		t.Fatalf("expected a securityRejection with reason \"replay\", got: %v", err)
+	}
+}
+
+func TestCheckNonceReplayRequiresNonceAndJTI(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{RequireNonce: true}
+	store := newInMemoryIntrospectionStore()
+
+	if err := checkNonceReplay(cfg, jwt.MapClaims{}, store); err == nil {
+		t.Fatal("expected missing nonce/jti to be rejected")
+	}
+
+	if err := checkNonceReplay(cfg, jwt.MapClaims{"nonce": "n-1"}, store); err == nil {
+		t.Fatal("expected a token with a nonce but no jti to be rejected")
+	}
+}
+
+func TestCheckExactAudienceRejectsUnknownAud(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{RequireExactAudience: true}
+	clientSet := map[string]string{"client-a": "policy-a"}
+
+	if err := checkExactAudience(cfg, "client-a", clientSet); err != nil {
+		t.Fatalf("expected single registered aud to pass, got: %v", err)
+	}
+
+	multiAud := []interface{}{"client-a", "client-unregistered"}
+	if err := checkExactAudience(cfg, multiAud, clientSet); err == nil {
+		t.Fatal("expected an unregistered aud entry to be rejected")
+	} else if rej, ok := err.(*securityRejection); !ok || rej.Reason != "aud_mismatch" {
+		t.Fatalf("expected a securityRejection with reason \"aud_mismatch\", got: %v", err)
+	}
+}
+
+func TestCheckAzpRequiredWhenAudMultiValued(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{RequireAzp: true}
+	multiAud := []interface{}{"client-a", "client-b"}
+
+	if err := checkAzp(cfg, multiAud, "client-a", jwt.MapClaims{}); err == nil {
+		t.Fatal("expected missing azp to be rejected when aud is multi-valued")
+	}
+
+	if err := checkAzp(cfg, multiAud, "client-a", jwt.MapClaims{"azp": "client-b"}); err == nil {
+		t.Fatal("expected azp mismatched with the matched client_id to be rejected")
+	}
+
+	if err := checkAzp(cfg, multiAud, "client-a", jwt.MapClaims{"azp": "client-a"}); err != nil {
+		t.Fatalf("expected matching azp to be accepted, got: %v", err)
+	}
+
+	if err := checkAzp(cfg, "client-a", "client-a", jwt.MapClaims{}); err != nil {
+		t.Fatalf("expected single-valued aud to skip the azp requirement, got: %v", err)
+	}
+}
+
+func TestCheckIssuerAllowlist(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{AllowedIssuers: []string{"^https://tenant-a\\."}}
+
+	if err := checkIssuerAllowlist(cfg, "https://tenant-a.example.com"); err != nil {
+		t.Fatalf("expected matching issuer to be accepted, got: %v", err)
+	}
+	if err := checkIssuerAllowlist(cfg, "https://tenant-b.example.com"); err == nil {
+		t.Fatal("expected non-matching issuer to be rejected")
+	}
+}
+
+func TestCheckTokenLifetimeRejectsLongLivedTokens(t *testing.T) {
+	cfg := apidef.OIDProviderConfig{MaxTokenLifetime: 3600}
+	claims := jwt.MapClaims{"iat": float64(0), "exp": float64(7200)}
+
+	if err := checkTokenLifetime(cfg, claims); err == nil {
+		t.Fatal("expected a token lifetime exceeding MaxTokenLifetime to be rejected")
+	}
+}
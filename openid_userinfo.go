@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserInfoCacheTTL = 5 * time.Minute
+	userInfoSweepInterval   = time.Minute
+)
+
+type cachedUserInfo struct {
+	claims    map[string]interface{}
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+func (e *cachedUserInfo) expired() bool {
+	return time.Since(e.fetchedAt) >= e.ttl
+}
+
+// UserInfoCache calls an OIDC provider's userinfo_endpoint and caches the
+// result per access token, so that enrichment doesn't hit the IdP on every
+// proxied request. Since tokens are per-session, an entry is never looked up
+// again once its token stops being used; a background sweep evicts expired
+// entries so the map doesn't grow without bound over the life of the
+// process.
+type UserInfoCache struct {
+	mu      sync.RWMutex
+	byToken map[string]*cachedUserInfo
+	client  *http.Client
+	done    chan struct{}
+}
+
+func newUserInfoCache() *UserInfoCache {
+	c := &UserInfoCache{
+		byToken: make(map[string]*cachedUserInfo),
+		client:  &http.Client{},
+		done:    make(chan struct{}),
+	}
+	go c.sweepLoop()
+	return c
+}
+
+// Stop ends the background sweep goroutine. Call it before discarding a
+// UserInfoCache, e.g. when New() replaces it on an API reload.
+func (c *UserInfoCache) Stop() {
+	close(c.done)
+}
+
+func (c *UserInfoCache) sweepLoop() {
+	ticker := time.NewTicker(userInfoSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+func (c *UserInfoCache) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.byToken {
+		if entry.expired() {
+			delete(c.byToken, key)
+		}
+	}
+}
+
+// Get returns the userinfo claims for rawToken, fetching and caching them
+// against endpoint if there is no fresh cache entry. timeout bounds the
+// fetch and falls back to defaultJWKSHTTPTimeout when zero.
+func (c *UserInfoCache) Get(endpoint, rawToken string, ttl, timeout time.Duration) (map[string]interface{}, error) {
+	if ttl <= 0 {
+		ttl = defaultUserInfoCacheTTL
+	}
+	key := fmt.Sprintf("%x", md5.Sum([]byte(rawToken)))
+
+	c.mu.RLock()
+	cached, ok := c.byToken[key]
+	c.mu.RUnlock()
+	if ok && !cached.expired() {
+		return cached.claims, nil
+	}
+
+	claims, err := c.fetch(endpoint, rawToken, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.byToken[key] = &cachedUserInfo{claims: claims, fetchedAt: time.Now(), ttl: ttl}
+	c.mu.Unlock()
+
+	return claims, nil
+}
+
+func (c *UserInfoCache) fetch(endpoint, rawToken string, timeout time.Duration) (map[string]interface{}, error) {
+	if timeout <= 0 {
+		timeout = defaultJWKSHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building userinfo request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling userinfo endpoint %q: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint %q returned status %d", endpoint, resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("decoding userinfo response: %v", err)
+	}
+	return claims, nil
+}
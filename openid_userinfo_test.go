@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserInfoCacheGetCachesWithinTTL(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprint(w, `{"sub":"user-1"}`)
+	}))
+	defer srv.Close()
+
+	c := newUserInfoCache()
+	defer c.Stop()
+
+	for i := 0; i < 3; i++ {
+		claims, err := c.Get(srv.URL, "token-1", time.Minute, time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if claims["sub"] != "user-1" {
+			t.Fatalf("unexpected claims: %v", claims)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected 1 fetch to be cached across repeated Get calls, got %d", hits)
+	}
+}
+
+// TestUserInfoCacheSweepEvictsExpiredEntries verifies that an expired entry
+// for a token that's never looked up again is still reclaimed, since tokens
+// are per-session and an entry may never be read again once its token falls
+// out of use.
+func TestUserInfoCacheSweepEvictsExpiredEntries(t *testing.T) {
+	c := newUserInfoCache()
+	defer c.Stop()
+
+	c.mu.Lock()
+	c.byToken["stale"] = &cachedUserInfo{claims: map[string]interface{}{"sub": "gone"}, fetchedAt: time.Now().Add(-time.Hour), ttl: time.Minute}
+	c.byToken["fresh"] = &cachedUserInfo{claims: map[string]interface{}{"sub": "kept"}, fetchedAt: time.Now(), ttl: time.Minute}
+	c.mu.Unlock()
+
+	c.sweep()
+
+	c.mu.RLock()
+	_, staleStillPresent := c.byToken["stale"]
+	_, freshStillPresent := c.byToken["fresh"]
+	c.mu.RUnlock()
+
+	if staleStillPresent {
+		t.Fatal("expected the expired entry to be evicted by sweep")
+	}
+	if !freshStillPresent {
+		t.Fatal("expected the unexpired entry to survive sweep")
+	}
+}